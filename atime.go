@@ -0,0 +1,147 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/folbricht/desync"
+	"go.etcd.io/bbolt"
+)
+
+var atimeBucket = []byte("atime")
+
+// AtimeTracker records the last time each chunk was actually served,
+// independent of filesystem atime semantics. gcOnce treats this as the
+// authoritative access time for a chunk when present, since the store
+// is commonly mounted with relatime or noatime where stat-based atime
+// is not a reliable LRU signal.
+type AtimeTracker struct {
+	mu      sync.Mutex
+	touched map[desync.ChunkID]time.Time
+	db      *bbolt.DB
+}
+
+// OpenAtimeTracker opens (creating if necessary) the BoltDB file used to
+// persist access times across restarts, next to the chunk store.
+func OpenAtimeTracker(storeBase string) (*AtimeTracker, error) {
+	db, err := bbolt.Open(filepath.Join(storeBase, "atime.db"), 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(atimeBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	tracker := &AtimeTracker{touched: map[desync.ChunkID]time.Time{}, db: db}
+	if err := tracker.Load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return tracker, nil
+}
+
+func (t *AtimeTracker) Close() error {
+	return t.db.Close()
+}
+
+// Touch records now as the access time for id. It is called by the HTTP
+// handler on every chunk read, so it must be cheap and non-blocking.
+func (t *AtimeTracker) Touch(id desync.ChunkID) {
+	t.mu.Lock()
+	t.touched[id] = time.Now()
+	t.mu.Unlock()
+}
+
+// Get returns the tracked access time for id, if one has been recorded,
+// either since the tracker was opened or loaded from BoltDB when it was.
+func (t *AtimeTracker) Get(id desync.ChunkID) (time.Time, bool) {
+	t.mu.Lock()
+	when, ok := t.touched[id]
+	t.mu.Unlock()
+	return when, ok
+}
+
+// Forget drops id's tracked access time, both in memory and in BoltDB.
+// Callers should call this alongside GcStateCache.Forget whenever a
+// chunk is actually removed from the store, so the tracker doesn't keep
+// every ID it has ever seen for the life of the process.
+func (t *AtimeTracker) Forget(id desync.ChunkID) error {
+	t.mu.Lock()
+	delete(t.touched, id)
+	t.mu.Unlock()
+
+	return t.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(atimeBucket).Delete(id[:])
+	})
+}
+
+// Flush persists the in-memory access times to BoltDB so they survive a
+// restart. Safe to call periodically from a ticker.
+func (t *AtimeTracker) Flush() error {
+	t.mu.Lock()
+	snapshot := make(map[desync.ChunkID]time.Time, len(t.touched))
+	for id, when := range t.touched {
+		snapshot[id] = when
+	}
+	t.mu.Unlock()
+
+	return t.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(atimeBucket)
+		for id, when := range snapshot {
+			buf, err := when.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(id[:], buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Load populates the in-memory map from BoltDB, e.g. after a restart.
+func (t *AtimeTracker) Load() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(atimeBucket)
+		return bucket.ForEach(func(k, v []byte) error {
+			var id desync.ChunkID
+			copy(id[:], k)
+
+			var when time.Time
+			if err := when.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			t.touched[id] = when
+			return nil
+		})
+	})
+}
+
+// runPeriodicFlush flushes the tracker every interval until stop is closed.
+func (t *AtimeTracker) runPeriodicFlush(interval time.Duration, stop <-chan struct{}, log func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := t.Flush(); err != nil {
+				log(err)
+			}
+		}
+	}
+}
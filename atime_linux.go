@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// atime returns the filesystem's last-access time for info. Callers should
+// treat this as a hint rather than ground truth: stores are commonly
+// mounted with relatime or noatime, under which this value lags or never
+// advances past ModTime. See AtimeTracker for the authoritative signal.
+func atime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// atime returns the filesystem's last-access time for info. Callers should
+// treat this as a hint rather than ground truth: NTFS last-access updates
+// are disabled by default on most Windows installs. See AtimeTracker for
+// the authoritative signal.
+func atime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(0, stat.LastAccessTime.Nanoseconds())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/folbricht/desync"
+)
+
+// RegisterChunkRoutes wires ServeChunkHTTP onto mux, alongside the
+// existing metrics/health/quarantine registrations.
+func (proxy *Proxy) RegisterChunkRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/store/", proxy.ServeChunkHTTP)
+}
+
+// ServeChunkHTTP serves a single chunk's compressed bytes, e.g.
+// GET /store/<4-hex-prefix>/<id>.cacnk, mirroring the on-disk shard
+// layout chunkFilePath uses. It reads through proxy.GetChunk rather
+// than the bare store, so every real cache hit updates atime/LRU.
+func (proxy *Proxy) ServeChunkHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := filepath.Base(r.URL.Path)
+	ext := filepath.Ext(name)
+	if ext != desync.CompressedChunkExt {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := desync.ChunkIDFromString(name[:len(name)-len(ext)])
+	if err != nil {
+		http.Error(w, "invalid chunk id", http.StatusBadRequest)
+		return
+	}
+
+	chunk, err := proxy.GetChunk(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := chunk.Data()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"container/heap"
 	"context"
+	"fmt"
 	"io"
 	"io/fs"
 	"math"
@@ -21,12 +23,18 @@ import (
 )
 
 var (
-	metricChunkCount   = metrics.MustInteger("spongix_chunk_count_local", "Number of chunks")
-	metricChunkGcCount = metrics.MustCounter("spongix_chunk_gc_count_local", "Number of chunks deleted by GC")
-	metricChunkGcSize  = metrics.MustCounter("spongix_chunk_gc_bytes_local", "Size of chunks deleted by GC")
-	metricChunkSize    = metrics.MustInteger("spongix_chunk_size_local", "Size of the chunks in bytes")
-	metricChunkWalk    = metrics.MustCounter("spongix_chunk_walk_local", "Total time spent walking the cache in ms")
-	metricChunkDirs    = metrics.MustInteger("spongix_chunk_dir_count", "Number of directories the chunks are stored in")
+	metricChunkCount            = metrics.MustInteger("spongix_chunk_count_local", "Number of chunks")
+	metricChunkGcCount          = metrics.MustCounter("spongix_chunk_gc_count_local", "Number of chunks deleted by GC")
+	metricChunkGcSize           = metrics.MustCounter("spongix_chunk_gc_bytes_local", "Size of chunks deleted by GC")
+	metricChunkSize             = metrics.MustInteger("spongix_chunk_size_local", "Size of the chunks in bytes")
+	metricChunkWalk             = metrics.MustCounter("spongix_chunk_walk_local", "Total time spent walking the cache in ms")
+	metricChunkDirs             = metrics.MustInteger("spongix_chunk_dir_count", "Number of directories the chunks are stored in")
+	metricChunkWalkShards       = metrics.MustInteger("spongix_chunk_walk_shards", "Number of shard directories dispatched to the parallel cache walker")
+	metricChunkWalkShardTime    = metrics.MustCounter("spongix_chunk_walk_shard_time", "Total time workers spent walking individual shard directories, in ms")
+	metricChunkWalkShardTimeMax = metrics.MustInteger("spongix_chunk_walk_shard_time_max", "Slowest single shard directory walk in the most recent run, in ms")
+
+	metricGcFullScan        = metrics.MustCounter("spongix_gc_full_scan_total", "Number of shard directories and index files fully rescanned because they were new or changed since the last generation")
+	metricGcIncrementalScan = metrics.MustCounter("spongix_gc_incremental_scan_total", "Number of shard directories and index files skipped and served from the GC state and index caches")
 
 	metricIndexCount   = metrics.MustInteger("spongix_index_count_local", "Number of indices")
 	metricIndexGcCount = metrics.MustCounter("spongix_index_gc_count_local", "Number of indices deleted by GC")
@@ -48,14 +56,96 @@ func measure(metric *metrics.Counter, f func()) {
 
 func (proxy *Proxy) gc() {
 	proxy.log.Debug("Initializing GC", zap.Duration("interval", proxy.GcInterval))
-	cacheStat := map[string]*chunkStat{}
-	measure(metricGcTime, func() { proxy.gcOnce(cacheStat) })
+
+	store := proxy.primaryStore()
+	if tracker, err := OpenAtimeTracker(store.Base); err != nil {
+		proxy.log.Error("opening atime tracker, falling back to mtime-based LRU", zap.Error(err))
+	} else {
+		proxy.atime = tracker
+		stop := make(chan struct{})
+		defer close(stop)
+		defer tracker.Close()
+		go tracker.runPeriodicFlush(time.Minute, stop, func(err error) {
+			proxy.log.Error("flushing atime tracker", zap.Error(err))
+		})
+	}
+
+	if cache, err := OpenGcStateCache(store.Base); err != nil {
+		proxy.log.Error("opening gc state cache, falling back to full scans every run", zap.Error(err))
+	} else {
+		proxy.gcCache = cache
+		defer cache.Close()
+	}
+
+	proxy.indexCache = NewIndexCache()
+
+	runGc := func() {
+		measure(metricGcTime, func() { proxy.gcOnce() })
+		proxy.purgeExpiredQuarantine()
+	}
+
+	runGc()
 
 	ticker := time.NewTicker(proxy.GcInterval)
 	for {
 		<-ticker.C
-		measure(metricGcTime, func() { proxy.gcOnce(cacheStat) })
+		runGc()
+	}
+}
+
+// purgeExpiredQuarantine deletes quarantine batches older than
+// QuarantineGracePeriod. It runs once per gcOnce tick so condemned
+// indices and chunks don't accumulate on disk forever waiting for an
+// operator to call the purge endpoint manually.
+func (proxy *Proxy) purgeExpiredQuarantine() {
+	indices := proxy.localIndex.(desync.LocalIndexStore)
+	cacheDir := cacheDirFromIndices(indices)
+
+	purged, err := proxy.PurgeQuarantine(cacheDir, proxy.QuarantineGracePeriod)
+	if err != nil {
+		proxy.log.Error("purging quarantine", zap.Error(err))
+		return
+	}
+	if purged > 0 {
+		proxy.log.Info("purged expired quarantine batches", zap.Int("count", purged))
+	}
+}
+
+// touchChunk records that id was just served from the local store, so
+// gcOnce can evict by true LRU order even on filesystems mounted with
+// relatime or noatime, where stat-based atime does not reflect real
+// usage. GetChunk is the only caller; anything serving chunk content to
+// a client should read through it rather than the bare store.
+func (proxy *Proxy) touchChunk(id desync.ChunkID) {
+	if proxy.atime != nil {
+		proxy.atime.Touch(id)
+	}
+}
+
+// GetChunk reads id through whichever local store backs the cache
+// (tiered or not) and records the access via touchChunk. HTTP handlers
+// serving chunk content should call this instead of reaching into
+// proxy.localStore directly, so every real cache hit updates the LRU.
+func (proxy *Proxy) GetChunk(id desync.ChunkID) (*desync.Chunk, error) {
+	var (
+		chunk *desync.Chunk
+		err   error
+	)
+
+	switch store := proxy.localStore.(type) {
+	case *TieredStore:
+		chunk, err = store.GetChunk(id)
+	case desync.LocalStore:
+		chunk, err = store.GetChunk(id)
+	default:
+		return nil, errors.New("no local store configured")
 	}
+
+	if err == nil {
+		proxy.touchChunk(id)
+	}
+
+	return chunk, err
 }
 
 func (proxy *Proxy) verify() {
@@ -71,14 +161,29 @@ func (proxy *Proxy) verify() {
 
 func (proxy *Proxy) verifyOnce() {
 	proxy.log.Info("store verify started")
-	store := proxy.localStore.(desync.LocalStore)
-	err := store.Verify(context.Background(), runtime.GOMAXPROCS(0), true, os.Stderr)
 
-	if err != nil {
-		proxy.log.Error("store verify failed", zap.Error(err))
-	} else {
-		proxy.log.Info("store verify completed")
+	for _, store := range proxy.verifyStores() {
+		if err := store.Verify(context.Background(), runtime.GOMAXPROCS(0), true, os.Stderr); err != nil {
+			proxy.log.Error("store verify failed", zap.Error(err))
+			return
+		}
+	}
+
+	proxy.log.Info("store verify completed")
+}
+
+// verifyStores returns every local store backing the cache, so a tiered
+// deployment gets each tier verified in turn instead of a single
+// desync.LocalStore type assertion panicking on a *TieredStore.
+func (proxy *Proxy) verifyStores() []desync.LocalStore {
+	if tiered, ok := proxy.localStore.(*TieredStore); ok {
+		stores := make([]desync.LocalStore, len(tiered.tiers))
+		for i, tier := range tiered.tiers {
+			stores[i] = tier.Store
+		}
+		return stores
 	}
+	return []desync.LocalStore{proxy.localStore.(desync.LocalStore)}
 }
 
 type chunkStat struct {
@@ -87,120 +192,256 @@ type chunkStat struct {
 	mtime time.Time
 }
 
+// chunkHeap is a min-heap of chunkStat ordered by mtime (access time), so
+// the oldest (most evictable) entry is always at the root. This keeps
+// chunkLRU.Add at O(log n) regardless of how many producers are feeding
+// it concurrently, unlike the sorted-slice insert it replaces.
+type chunkHeap []*chunkStat
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return h[i].mtime.Before(h[j].mtime) }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *chunkHeap) Push(x interface{}) {
+	*h = append(*h, x.(*chunkStat))
+}
+
+func (h *chunkHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
 type chunkLRU struct {
-	live        []*chunkStat
+	live        chunkHeap
 	liveSize    uint64
 	liveSizeMax uint64
 	dead        map[desync.ChunkID]struct{}
 	deadSize    uint64
+	// corrupt is the subset of dead whose chunk file failed to read
+	// during the walk (AddDead), as opposed to ones the live heap
+	// evicted for exceeding the size budget (Add). Only the latter are
+	// safe to demote to a slower tier; a corrupt chunk needs deleting
+	// wherever it's found.
+	corrupt map[desync.ChunkID]struct{}
 }
 
 func NewLRU(liveSizeMax uint64) *chunkLRU {
 	return &chunkLRU{
-		live:        []*chunkStat{},
+		live:        chunkHeap{},
 		liveSizeMax: liveSizeMax,
 		dead:        map[desync.ChunkID]struct{}{},
+		corrupt:     map[desync.ChunkID]struct{}{},
 	}
 }
 
+// AddDead, like Add, is not safe for concurrent use: callers must serialize through a
+// single collector goroutine, as gcOnce's sharded walker does.
 func (l *chunkLRU) AddDead(stat *chunkStat) {
 	l.dead[stat.id] = yes
 	l.deadSize += uint64(stat.size)
+	l.corrupt[stat.id] = yes
 }
 
 func (l *chunkLRU) Add(stat *chunkStat) {
-	isOlder := func(i int) bool { return l.live[i].mtime.Before(stat.mtime) }
-	i := sort.Search(len(l.live), isOlder)
-	l.insertAt(i, stat)
+	heap.Push(&l.live, stat)
 	l.liveSize += uint64(stat.size)
-	for l.liveSize > l.liveSizeMax {
-		die := l.live[len(l.live)-1]
+	for l.liveSize > l.liveSizeMax && l.live.Len() > 0 {
+		die := heap.Pop(&l.live).(*chunkStat)
 		l.dead[die.id] = yes
-		l.live = l.live[:len(l.live)-1]
 		l.deadSize += uint64(die.size)
 		l.liveSize -= uint64(die.size)
 	}
 }
 
-func (l *chunkLRU) insertAt(i int, v *chunkStat) {
-	if i == len(l.live) {
-		l.live = append(l.live, v)
-	} else {
-		l.live = append(l.live[:i+1], l.live[i:]...)
-		l.live[i] = v
-	}
-}
-
 func (l *chunkLRU) IsDead(id desync.ChunkID) bool {
 	_, found := l.dead[id]
 	return found
 }
 
+// IsCorrupt reports whether id was marked dead because its chunk file
+// failed to read, rather than because the live heap evicted it.
+func (l *chunkLRU) IsCorrupt(id desync.ChunkID) bool {
+	_, found := l.corrupt[id]
+	return found
+}
+
 func (l *chunkLRU) Dead() map[desync.ChunkID]struct{} {
 	return l.dead
 }
 
-// we assume every directory requires 4KB of size (one block) desync stores
-// files in directories with a 4 hex prefix, so we need to keep at least this
-// amount of space reserved.
-const maxCacheDirPortion = 0xffff * 4096
-
-type integrityCheck struct {
-	path  string
-	index desync.Index
+// chunkWalkResult is what a shard worker hands back to the single
+// collector goroutine that owns the chunkLRU.
+type chunkWalkResult struct {
+	stat *chunkStat
+	dead bool
 }
 
-func checkNarContents(store desync.Store, idx desync.Index) error {
-	buf := newAssembler(store, idx)
-	narRd, err := nar.NewReader(buf)
+// walkStore enumerates the top-level 4-hex prefix shard directories under
+// store.Base and walks them in parallel across a worker pool, instead of
+// a single filepath.Walk over the whole store. Chunk classification (live
+// vs dead) happens in the workers; only the final chunkLRU.Add/AddDead
+// calls are serialized through the returned results, since chunkLRU is
+// not safe for concurrent use.
+func (proxy *Proxy) walkStore(store desync.LocalStore, lru *chunkLRU, generation uint64) (int64, error) {
+	entries, err := os.ReadDir(store.Base)
 	if err != nil {
-		return err
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
 	}
-	none := true
-	for {
-		if _, err := narRd.Next(); err == nil {
-			none = false
-		} else if err == io.EOF {
-			break
+
+	shards := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			shards = append(shards, filepath.Join(store.Base, entry.Name()))
+		}
+	}
+
+	metricChunkWalkShards.Set(int64(len(shards)))
+
+	shardCh := make(chan string)
+	results := make(chan chunkWalkResult, 64)
+
+	var (
+		mu         sync.Mutex
+		chunkDirs  int64
+		walkErrors []error
+		timings    []shardTiming
+	)
+
+	workers := runtime.GOMAXPROCS(0)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range shardCh {
+				shardStart := time.Now()
+				dirs, err := proxy.walkChunkShard(store, dir, generation, results)
+				duration := time.Since(shardStart)
+				metricChunkWalkShardTime.Add(uint64(duration.Milliseconds()))
+
+				mu.Lock()
+				chunkDirs += dirs
+				if err != nil {
+					walkErrors = append(walkErrors, err)
+				}
+				timings = append(timings, shardTiming{dir: dir, duration: duration})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	go func() {
+		for _, dir := range shards {
+			shardCh <- dir
+		}
+		close(shardCh)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		if res.dead {
+			lru.AddDead(res.stat)
 		} else {
-			return err
+			lru.Add(res.stat)
 		}
 	}
 
-	if none {
-		return errors.New("no contents in NAR")
+	proxy.logSlowestShards(timings)
+
+	if len(walkErrors) > 0 {
+		return chunkDirs, walkErrors[0]
 	}
 
-	return nil
+	return chunkDirs, nil
 }
 
-/*
-Local GC strategies:
-  Check every index file:
-    If chunks are missing, delete it.
-  	If it is not referenced by the database anymore, delete it.
-  Check every narinfo in the database:
-    If index is missing, delete it.
-  	If last access is too old, delete it.
-*/
-func (proxy *Proxy) gcOnce(cacheStat map[string]*chunkStat) {
-	maxCacheSize := (uint64(math.Pow(2, 30)) * proxy.CacheSize) - maxCacheDirPortion
-	store := proxy.localStore.(desync.LocalStore)
-	indices := proxy.localIndex.(desync.LocalIndexStore)
-	lru := NewLRU(maxCacheSize)
-	walkStoreStart := time.Now()
-	chunkDirs := int64(0)
+// shardTiming records how long a single shard directory took to walk,
+// so logSlowestShards can name the stragglers instead of just summing
+// them into a single counter.
+type shardTiming struct {
+	dir      string
+	duration time.Duration
+}
 
-	metricMaxSize.Set(int64(maxCacheSize))
+// logSlowestShards sets metricChunkWalkShardTimeMax to the slowest
+// shard in this run and logs the top few offenders by name, so a run
+// dominated by one or two straggler directories is visible instead of
+// hiding behind the summed spongix_chunk_walk_shard_time counter.
+func (proxy *Proxy) logSlowestShards(timings []shardTiming) {
+	if len(timings) == 0 {
+		return
+	}
+
+	sort.Slice(timings, func(i, j int) bool { return timings[i].duration > timings[j].duration })
+
+	metricChunkWalkShardTimeMax.Set(timings[0].duration.Milliseconds())
+
+	const topN = 3
+	for i := 0; i < topN && i < len(timings); i++ {
+		proxy.log.Debug(
+			"slow shard walk",
+			zap.String("dir", timings[i].dir),
+			zap.Duration("duration", timings[i].duration),
+		)
+	}
+}
+
+// walkChunkShard walks a single shard directory, stats and classifies
+// each chunk file it finds, and pushes the result to results. walkStore's
+// worker pool runs it concurrently, one call per shard directory.
+//
+// If proxy.gcCache has an entry for dir whose recorded mtime still
+// matches the directory's current mtime, no chunk has been added to or
+// removed from dir since the last full scan (removing a chunk file
+// always bumps its parent directory's mtime), so the cached inventory
+// is reused instead of re-stating every file.
+func (proxy *Proxy) walkChunkShard(store desync.LocalStore, dir string, generation uint64, results chan<- chunkWalkResult) (int64, error) {
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	dirMtime := dirInfo.ModTime()
+
+	if proxy.gcCache != nil {
+		if stats, ok := proxy.gcCache.ShardUnchanged(dir, dirMtime, generation); ok {
+			metricGcIncrementalScan.Add(1)
+			for _, stat := range stats {
+				if proxy.atime != nil {
+					if tracked, ok := proxy.atime.Get(stat.id); ok {
+						stat.mtime = tracked
+					}
+				}
+				results <- chunkWalkResult{stat: stat, dead: false}
+			}
+			return 1, nil
+		}
+	}
 
-	// filepath.Walk is faster for our usecase because we need the stat result anyway.
-	walkStoreErr := filepath.Walk(store.Base, func(path string, info fs.FileInfo, err error) error {
+	metricGcFullScan.Add(1)
+
+	chunkDirs := int64(0)
+	var liveStats []*chunkStat
+
+	err = filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
-			if err == os.ErrNotExist {
+			if os.IsNotExist(err) {
 				return nil
-			} else {
-				return err
 			}
+			return err
 		}
 
 		if info.IsDir() {
@@ -225,18 +466,153 @@ func (proxy *Proxy) gcOnce(cacheStat map[string]*chunkStat) {
 			return err
 		}
 
-		stat := &chunkStat{id: id, size: info.Size(), mtime: info.ModTime()}
+		chunkAtime := atime(info)
+		if proxy.atime != nil {
+			if tracked, ok := proxy.atime.Get(id); ok {
+				chunkAtime = tracked
+			}
+		}
+
+		stat := &chunkStat{id: id, size: info.Size(), mtime: chunkAtime}
 
 		if _, err := store.GetChunk(id); err != nil {
 			proxy.log.Error("getting chunk", zap.Error(err), zap.String("chunk", id.String()))
-			lru.AddDead(stat)
+			results <- chunkWalkResult{stat: stat, dead: true}
 		} else {
-			lru.Add(stat)
+			liveStats = append(liveStats, stat)
+			results <- chunkWalkResult{stat: stat, dead: false}
 		}
 
 		return nil
 	})
 
+	if err == nil && proxy.gcCache != nil {
+		if cacheErr := proxy.gcCache.UpdateShard(dir, dirMtime, liveStats, generation); cacheErr != nil {
+			proxy.log.Error("updating gc state cache", zap.Error(cacheErr), zap.String("dir", dir))
+		}
+	}
+
+	return chunkDirs, err
+}
+
+// we assume every directory requires 4KB of size (one block) desync stores
+// files in directories with a 4 hex prefix, so we need to keep at least this
+// amount of space reserved.
+const maxCacheDirPortion = 0xffff * 4096
+
+type integrityCheck struct {
+	path  string
+	index desync.Index
+}
+
+// narIntegrityError carries the byte offset into the NAR stream at
+// which a parse or content error was found, so quarantine manifests can
+// record more than just a free-text message.
+type narIntegrityError struct {
+	offset int64
+	reason string
+}
+
+func (e *narIntegrityError) Error() string {
+	return fmt.Sprintf("%s (offset %d)", e.reason, e.offset)
+}
+
+// countingReader tracks how many bytes have been read through it, so
+// errors further down the chain can be attributed to an approximate
+// offset in the underlying NAR stream.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// checkNarContents walks every entry of the NAR assembled from idx and,
+// for regular files, actually reads the body through io.Discard and
+// checks the byte count against the size the NAR header declared. A
+// truncated chunk produces a short read here even though the header
+// itself parsed fine, which a header-only check (just calling Next())
+// would miss entirely.
+func checkNarContents(store desync.Store, idx desync.Index) error {
+	counting := &countingReader{r: newAssembler(store, idx)}
+	narRd, err := nar.NewReader(counting)
+	if err != nil {
+		return &narIntegrityError{offset: counting.n, reason: errors.WithMessage(err, "opening NAR").Error()}
+	}
+
+	none := true
+	for {
+		header, err := narRd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &narIntegrityError{offset: counting.n, reason: errors.WithMessage(err, "parsing NAR header").Error()}
+		}
+		none = false
+
+		if header.Type != nar.TypeRegular {
+			continue
+		}
+
+		n, err := io.Copy(io.Discard, narRd)
+		if err != nil {
+			return &narIntegrityError{offset: counting.n, reason: errors.WithMessagef(err, "reading contents of %s", header.Path).Error()}
+		}
+		if n != header.Size {
+			return &narIntegrityError{
+				offset: counting.n,
+				reason: fmt.Sprintf("size mismatch for %s: header declared %d bytes, read %d", header.Path, header.Size, n),
+			}
+		}
+	}
+
+	if none {
+		return errors.New("no contents in NAR")
+	}
+
+	return nil
+}
+
+/*
+Local GC strategies:
+
+	Check every index file:
+	  If chunks are missing, delete it.
+		If it is not referenced by the database anymore, delete it.
+	Check every narinfo in the database:
+	  If index is missing, delete it.
+		If last access is too old, delete it.
+*/
+func (proxy *Proxy) gcOnce() {
+	if tiered, ok := proxy.localStore.(*TieredStore); ok {
+		proxy.gcOnceTiered(tiered)
+		return
+	}
+
+	maxCacheSize := (uint64(math.Pow(2, 30)) * proxy.CacheSize) - maxCacheDirPortion
+	store := proxy.localStore.(desync.LocalStore)
+	indices := proxy.localIndex.(desync.LocalIndexStore)
+	lru := NewLRU(maxCacheSize)
+	walkStoreStart := time.Now()
+
+	metricMaxSize.Set(int64(maxCacheSize))
+
+	var generation uint64
+	if proxy.gcCache != nil {
+		if gen, err := proxy.gcCache.NextGeneration(); err != nil {
+			proxy.log.Error("advancing gc state cache generation", zap.Error(err))
+		} else {
+			generation = gen
+		}
+	}
+
+	chunkDirs, walkStoreErr := proxy.walkStore(store, lru, generation)
+
 	metricChunkWalk.Add(uint64(time.Since(walkStoreStart).Milliseconds()))
 	metricChunkDirs.Set(chunkDirs)
 
@@ -250,42 +626,140 @@ func (proxy *Proxy) gcOnce(cacheStat map[string]*chunkStat) {
 	metricChunkGcSize.Add(lru.deadSize)
 	metricChunkSize.Set(int64(lru.liveSize))
 
-	deadIndices := &sync.Map{}
+	deadIndexCount, walkIndicesTime := proxy.gcIndices(store, indices, lru, []desync.LocalStore{store})
+
+	// we don't use store.Prune because it does another filepath.Walk and no
+	// added benefit for us.
+
+	for id := range lru.Dead() {
+		if err := store.RemoveChunk(id); err != nil {
+			proxy.log.Error("Removing chunk", zap.Error(err), zap.String("id", id.String()))
+		}
+		if proxy.gcCache != nil {
+			_ = proxy.gcCache.Forget(id)
+		}
+		if proxy.atime != nil {
+			_ = proxy.atime.Forget(id)
+		}
+	}
+
+	if proxy.gcCache != nil {
+		proxy.scrubGcCache(store, generation)
+	}
+
+	proxy.log.Debug(
+		"GC stats",
+		zap.Uint64("live_bytes", lru.liveSize),
+		zap.Uint64("live_max_bytes", lru.liveSizeMax),
+		zap.Int("live_chunk_count", len(lru.live)),
+		zap.Uint64("dead_bytes", lru.deadSize),
+		zap.Int("dead_chunk_count", len(lru.dead)),
+		zap.Uint64("dead_index_count", deadIndexCount),
+		zap.Duration("walk_indices_time", walkIndicesTime),
+	)
+}
+
+// deadChecker is satisfied by chunkLRU; it lets gcIndices check index
+// liveness against either a single-tier LRU or the last tier's LRU in a
+// tiered deployment, where only eviction past the final tier means a
+// chunk is actually gone.
+type deadChecker interface {
+	IsDead(id desync.ChunkID) bool
+}
+
+// scrubGcCache re-verifies a rotating ~5% slice of the persistent GC
+// state cache each generation, so a chunk removed outside of gcOnce
+// (e.g. manually) is eventually noticed even though its shard
+// directory's mtime didn't change.
+func (proxy *Proxy) scrubGcCache(store desync.LocalStore, generation uint64) {
+	const scrubBuckets = 20
+
+	candidates, err := proxy.gcCache.ScrubCandidates(generation, scrubBuckets)
+	if err != nil {
+		proxy.log.Error("listing gc scrub candidates", zap.Error(err))
+	}
+
+	for _, id := range candidates {
+		if _, err := store.GetChunk(id); err != nil {
+			proxy.log.Warn("scrub found drifted cache entry, chunk missing from store", zap.String("chunk", id.String()))
+			_ = proxy.gcCache.Forget(id)
+			if proxy.atime != nil {
+				_ = proxy.atime.Forget(id)
+			}
+		}
+	}
+}
+
+// gcIndices checks every narinfo/NAR index under indices.Path for
+// missing or dead chunks and quarantines any that reference a chunk
+// dead reports as gone (see condemn), unless isIntegrityExempt exempts
+// its path. chunkBases is searched, in order, for chunks exclusively
+// referenced by a quarantined index so they can be quarantined too; for
+// a plain single-tier cache it's just that one store, for a TieredStore
+// it's every tier. Returns how many indices were quarantined and how
+// long the walk took.
+func (proxy *Proxy) gcIndices(store desync.Store, indices desync.LocalIndexStore, dead deadChecker, chunkBases []desync.LocalStore) (uint64, time.Duration) {
+	deadIndices := &sync.Map{} // path -> *condemnReason
+	indexChunks := map[string][]desync.ChunkID{}
+	chunkRefCount := map[desync.ChunkID]int{}
+
 	walkIndicesStart := time.Now()
 	indicesCount := int64(0)
 	inflatedSize := int64(0)
 	ignoreBeforeTime := time.Now().Add(10 * time.Minute)
 
+	condemn := func(path, reason string, offset int64) {
+		name := path[len(indices.Path):]
+		if proxy.isIntegrityExempt(name) {
+			proxy.log.Warn("integrity failure on exempted path, leaving in place", zap.String("path", path), zap.String("reason", reason))
+			return
+		}
+		deadIndices.Store(path, &condemnReason{IndexPath: path, Reason: reason, ParseOffset: offset})
+	}
+
+	recordChunks := func(path string, chunks []desync.IndexChunk) {
+		ids := make([]desync.ChunkID, len(chunks))
+		for i, c := range chunks {
+			ids[i] = c.ID
+			chunkRefCount[c.ID]++
+		}
+		indexChunks[path] = ids
+	}
+
 	integrity := make(chan integrityCheck)
 	wg := &sync.WaitGroup{}
 
+	// Workers run for the lifetime of the walk below, exiting only when
+	// the walk closes integrity. They used to idle out after 1s of no
+	// work, which could let every worker exit mid-walk (checkNarContents
+	// now reads whole file bodies, not just headers, so a single slow
+	// check easily exceeds that) and wedge the producer's send forever.
 	for i := 0; i < 3; i++ {
 		wg.Add(1)
 
-		go func(n int) {
+		go func() {
 			defer wg.Done()
 
-			for {
-				select {
-				case <-time.After(1 * time.Second):
-					return
-				case check := <-integrity:
-					switch filepath.Ext(check.path) {
-					case ".nar":
-						if err := checkNarContents(store, check.index); err != nil {
-							proxy.log.Error("checking NAR contents", zap.Error(err), zap.String("path", check.path))
-							deadIndices.Store(check.path, yes)
-							continue
-						}
-					case ".narinfo":
-						if _, err := assembleNarinfo(store, check.index); err != nil {
-							proxy.log.Error("checking narinfo", zap.Error(err), zap.String("path", check.path))
-							deadIndices.Store(check.path, yes)
+			for check := range integrity {
+				switch filepath.Ext(check.path) {
+				case ".nar":
+					if err := checkNarContents(store, check.index); err != nil {
+						proxy.log.Error("checking NAR contents", zap.Error(err), zap.String("path", check.path))
+						offset := int64(-1)
+						if narErr, ok := err.(*narIntegrityError); ok {
+							offset = narErr.offset
 						}
+						condemn(check.path, err.Error(), offset)
+						continue
+					}
+				case ".narinfo":
+					if _, err := assembleNarinfo(store, check.index); err != nil {
+						proxy.log.Error("checking narinfo", zap.Error(err), zap.String("path", check.path))
+						condemn(check.path, err.Error(), -1)
 					}
 				}
 			}
-		}(i)
+		}()
 	}
 
 	walkIndicesErr := filepath.Walk(indices.Path, func(path string, info fs.FileInfo, err error) error {
@@ -305,24 +779,50 @@ func (proxy *Proxy) gcOnce(cacheStat map[string]*chunkStat) {
 
 		name := path[len(indices.Path):]
 
+		if cached, ok := proxy.indexCache.Get(path, info.ModTime()); ok {
+			metricGcIncrementalScan.Add(1)
+			inflatedSize += cached.Length()
+			indicesCount++
+			recordChunks(path, cached.Chunks)
+
+			if len(cached.Chunks) == 0 {
+				condemn(path, "index has no chunks", -1)
+			} else {
+				for _, indexChunk := range cached.Chunks {
+					if dead.IsDead(indexChunk.ID) {
+						proxy.log.Debug("some chunks are dead", zap.String("path", path))
+						condemn(path, fmt.Sprintf("chunk %s is dead", indexChunk.ID), -1)
+						break
+					}
+				}
+			}
+
+			return nil
+		}
+
+		metricGcFullScan.Add(1)
+
 		index, err := indices.GetIndex(name)
 		if err != nil {
 			return errors.WithMessagef(err, "while getting index %s", name)
 		}
 
+		proxy.indexCache.Put(path, info.ModTime(), index)
+
 		integrity <- integrityCheck{path: path, index: index}
 
 		inflatedSize += index.Length()
 		indicesCount++
+		recordChunks(path, index.Chunks)
 
 		if len(index.Chunks) == 0 {
 			proxy.log.Debug("index chunks are empty", zap.String("path", path))
-			deadIndices.Store(path, yes)
+			condemn(path, "index has no chunks", -1)
 		} else {
 			for _, indexChunk := range index.Chunks {
-				if lru.IsDead(indexChunk.ID) {
+				if dead.IsDead(indexChunk.ID) {
 					proxy.log.Debug("some chunks are dead", zap.String("path", path))
-					deadIndices.Store(path, yes)
+					condemn(path, fmt.Sprintf("chunk %s is dead", indexChunk.ID), -1)
 					break
 				}
 			}
@@ -331,46 +831,157 @@ func (proxy *Proxy) gcOnce(cacheStat map[string]*chunkStat) {
 		return nil
 	})
 
-	wg.Wait()
 	close(integrity)
+	wg.Wait()
 
 	metricIndexCount.Set(indicesCount)
 	metricIndexWalk.Add(uint64(time.Since(walkIndicesStart).Milliseconds()))
 	metricInflated.Set(inflatedSize)
 
+	walkIndicesTime := time.Since(walkIndicesStart)
+
 	if walkIndicesErr != nil {
 		proxy.log.Error("While walking index", zap.Error(walkIndicesErr))
-		return
+		return 0, walkIndicesTime
+	}
+
+	present := make(map[string]struct{}, len(indexChunks))
+	for path := range indexChunks {
+		present[path] = struct{}{}
 	}
-	deadIndexCount := uint64(0)
-	// time.Sleep(10 * time.Minute)
+	proxy.indexCache.Prune(present)
+
+	var reasons []condemnReason
 	deadIndices.Range(func(key, value interface{}) bool {
-		path := key.(string)
-		proxy.log.Debug("moving index to trash", zap.String("path", path))
-		_ = os.Remove(path)
-		deadIndexCount++
+		reason := value.(*condemnReason)
+		for _, id := range indexChunks[reason.IndexPath] {
+			if chunkRefCount[id] == 1 {
+				reason.ExclusiveChunks = append(reason.ExclusiveChunks, id.String())
+			}
+		}
+		reasons = append(reasons, *reason)
 		return true
 	})
 
+	if len(reasons) > 0 {
+		locateChunk := func(id desync.ChunkID) (string, bool) {
+			for _, base := range chunkBases {
+				path := chunkFilePath(base.Base, id)
+				if _, err := os.Stat(path); err == nil {
+					return path, true
+				}
+			}
+			return "", false
+		}
+
+		cacheDir := cacheDirFromIndices(indices)
+		if err := proxy.quarantineIndices(cacheDir, indices.Path, locateChunk, reasons, time.Now()); err != nil {
+			proxy.log.Error("quarantining dead indices", zap.Error(err))
+		}
+	}
+
+	deadIndexCount := uint64(len(reasons))
 	metricIndexGcCount.Add(deadIndexCount)
 
-	// we don't use store.Prune because it does another filepath.Walk and no
-	// added benefit for us.
+	return deadIndexCount, walkIndicesTime
+}
 
-	for id := range lru.Dead() {
-		if err := store.RemoveChunk(id); err != nil {
-			proxy.log.Error("Removing chunk", zap.Error(err), zap.String("id", id.String()))
+// gcOnceTiered runs gcOnce's eviction policy per tier of a TieredStore:
+// chunks the LRU would otherwise delete from tier N are instead demoted
+// to tier N+1, and only chunks evicted past the final tier are actually
+// gone. Indices are checked once at the end against the final tier's
+// dead set.
+func (proxy *Proxy) gcOnceTiered(tiered *TieredStore) {
+	var lastTierLRU *chunkLRU
+
+	var generation uint64
+	if proxy.gcCache != nil {
+		if gen, err := proxy.gcCache.NextGeneration(); err != nil {
+			proxy.log.Error("advancing gc state cache generation", zap.Error(err))
+		} else {
+			generation = gen
+		}
+	}
+
+	for i, tier := range tiered.tiers {
+		maxCacheSize := tier.SizeGB*uint64(math.Pow(2, 30)) - maxCacheDirPortion
+		tm := metricsForTier(tier.Name)
+		tm.maxSize.Set(int64(maxCacheSize))
+
+		lru := NewLRU(maxCacheSize)
+		walkStoreStart := time.Now()
+		_, walkErr := proxy.walkStore(tier.Store, lru, generation)
+		metricChunkWalk.Add(uint64(time.Since(walkStoreStart).Milliseconds()))
+
+		if walkErr != nil {
+			proxy.log.Error("While walking tier store", zap.Error(walkErr), zap.String("tier", tier.Name))
+			return
+		}
+
+		tm.chunkCount.Set(int64(len(lru.live)))
+		tm.chunkSize.Set(int64(lru.liveSize))
+		tm.gcCount.Add(uint64(len(lru.dead)))
+		tm.gcSize.Add(lru.deadSize)
+
+		if i+1 < len(tiered.tiers) {
+			next := tiered.tiers[i+1]
+			for id := range lru.Dead() {
+				if lru.IsCorrupt(id) {
+					if err := tier.Store.RemoveChunk(id); err != nil {
+						proxy.log.Error("removing corrupt chunk", zap.Error(err), zap.String("id", id.String()), zap.String("tier", tier.Name))
+					}
+					if proxy.atime != nil {
+						_ = proxy.atime.Forget(id)
+					}
+					if proxy.gcCache != nil {
+						_ = proxy.gcCache.Forget(id)
+					}
+					continue
+				}
+				if err := demoteChunk(tier, next, id); err != nil {
+					proxy.log.Error(
+						"demoting chunk",
+						zap.Error(err),
+						zap.String("id", id.String()),
+						zap.String("from_tier", tier.Name),
+						zap.String("to_tier", next.Name),
+					)
+				}
+			}
+		} else {
+			for id := range lru.Dead() {
+				if err := tier.Store.RemoveChunk(id); err != nil {
+					proxy.log.Error("Removing chunk", zap.Error(err), zap.String("id", id.String()), zap.String("tier", tier.Name))
+				}
+				if proxy.atime != nil {
+					_ = proxy.atime.Forget(id)
+				}
+				if proxy.gcCache != nil {
+					_ = proxy.gcCache.Forget(id)
+				}
+			}
 		}
+
+		if proxy.gcCache != nil {
+			proxy.scrubGcCache(tier.Store, generation)
+		}
+
+		lastTierLRU = lru
 	}
 
+	indices := proxy.localIndex.(desync.LocalIndexStore)
+
+	chunkBases := make([]desync.LocalStore, len(tiered.tiers))
+	for i, tier := range tiered.tiers {
+		chunkBases[i] = tier.Store
+	}
+
+	deadIndexCount, walkIndicesTime := proxy.gcIndices(tiered, indices, lastTierLRU, chunkBases)
+
 	proxy.log.Debug(
-		"GC stats",
-		zap.Uint64("live_bytes", lru.liveSize),
-		zap.Uint64("live_max_bytes", lru.liveSizeMax),
-		zap.Int("live_chunk_count", len(lru.live)),
-		zap.Uint64("dead_bytes", lru.deadSize),
-		zap.Int("dead_chunk_count", len(lru.dead)),
+		"tiered GC stats",
+		zap.Int("tier_count", len(tiered.tiers)),
 		zap.Uint64("dead_index_count", deadIndexCount),
-		zap.Duration("walk_indices_time", time.Since(walkIndicesStart)),
+		zap.Duration("walk_indices_time", walkIndicesTime),
 	)
 }
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/folbricht/desync"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	gcBucketChunks      = []byte("chunks")
+	gcBucketShards      = []byte("shards")
+	gcBucketMeta        = []byte("meta")
+	gcMetaGenerationKey = []byte("generation")
+)
+
+// chunkCacheEntry is the persisted record for a single chunk, keyed by
+// its ChunkID in the "chunks" bucket of GcStateCache.
+type chunkCacheEntry struct {
+	Size               int64
+	Atime              time.Time
+	LastSeenGeneration uint64
+}
+
+// shardCacheEntry records the chunks found in a shard directory the
+// last time it was fully scanned, along with the directory's mtime at
+// that point. As long as the directory's mtime hasn't changed, gcOnce
+// can reuse this instead of re-stating every file in the shard.
+type shardCacheEntry struct {
+	Mtime  time.Time
+	Chunks []desync.ChunkID
+	Sizes  []int64
+}
+
+// GcStateCache persists the chunk inventory gathered by gcOnce across
+// GcInterval ticks (and restarts), so a tick only needs to fully rescan
+// shard directories whose mtime changed since the previous generation,
+// rather than re-stating and re-verifying the whole store every time.
+type GcStateCache struct {
+	db *bbolt.DB
+}
+
+func OpenGcStateCache(storeBase string) (*GcStateCache, error) {
+	db, err := bbolt.Open(filepath.Join(storeBase, "gcstate.db"), 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{gcBucketChunks, gcBucketShards, gcBucketMeta} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &GcStateCache{db: db}, nil
+}
+
+func (c *GcStateCache) Close() error {
+	return c.db.Close()
+}
+
+// NextGeneration increments and persists the GC generation counter,
+// returning the new value. Called once at the start of each gcOnce run.
+func (c *GcStateCache) NextGeneration() (uint64, error) {
+	var generation uint64
+
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(gcBucketMeta)
+		if buf := bucket.Get(gcMetaGenerationKey); buf != nil {
+			generation = binary.BigEndian.Uint64(buf)
+		}
+		generation++
+
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, generation)
+		return bucket.Put(gcMetaGenerationKey, buf)
+	})
+
+	return generation, err
+}
+
+// ShardUnchanged returns the cached chunk inventory for dir, and true,
+// if dir's mtime matches what was recorded during its last full scan.
+// Chunk entries it returns have their LastSeenGeneration refreshed to
+// generation. Otherwise it returns false and the caller must fully rescan dir.
+func (c *GcStateCache) ShardUnchanged(dir string, mtime time.Time, generation uint64) ([]*chunkStat, bool) {
+	var stats []*chunkStat
+	found := false
+
+	_ = c.db.Update(func(tx *bbolt.Tx) error {
+		shards := tx.Bucket(gcBucketShards)
+		buf := shards.Get([]byte(dir))
+		if buf == nil {
+			return nil
+		}
+
+		var entry shardCacheEntry
+		if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&entry); err != nil || !entry.Mtime.Equal(mtime) {
+			return nil
+		}
+
+		chunks := tx.Bucket(gcBucketChunks)
+		stats = make([]*chunkStat, 0, len(entry.Chunks))
+
+		for i, id := range entry.Chunks {
+			var chunkAtime time.Time
+			if cbuf := chunks.Get(id[:]); cbuf != nil {
+				var chunkEntry chunkCacheEntry
+				if err := gob.NewDecoder(bytes.NewReader(cbuf)).Decode(&chunkEntry); err == nil {
+					chunkAtime = chunkEntry.Atime
+				}
+			}
+			stats = append(stats, &chunkStat{id: id, size: entry.Sizes[i], mtime: chunkAtime})
+
+			refreshed := chunkCacheEntry{Size: entry.Sizes[i], Atime: chunkAtime, LastSeenGeneration: generation}
+			var out bytes.Buffer
+			if err := gob.NewEncoder(&out).Encode(refreshed); err == nil {
+				_ = chunks.Put(id[:], out.Bytes())
+			}
+		}
+
+		found = true
+		return nil
+	})
+
+	return stats, found
+}
+
+// UpdateShard persists the chunk inventory discovered by a full scan of
+// dir, so the next run can skip it entirely while dir's mtime is
+// unchanged.
+func (c *GcStateCache) UpdateShard(dir string, mtime time.Time, stats []*chunkStat, generation uint64) error {
+	entry := shardCacheEntry{
+		Mtime:  mtime,
+		Chunks: make([]desync.ChunkID, len(stats)),
+		Sizes:  make([]int64, len(stats)),
+	}
+
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		chunks := tx.Bucket(gcBucketChunks)
+		shards := tx.Bucket(gcBucketShards)
+
+		for i, stat := range stats {
+			entry.Chunks[i] = stat.id
+			entry.Sizes[i] = stat.size
+
+			chunkEntry := chunkCacheEntry{Size: stat.size, Atime: stat.mtime, LastSeenGeneration: generation}
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(chunkEntry); err != nil {
+				return err
+			}
+			if err := chunks.Put(stat.id[:], buf.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+			return err
+		}
+		return shards.Put([]byte(dir), buf.Bytes())
+	})
+}
+
+// Forget removes a chunk's cache entry, e.g. once gcOnce has removed it
+// from the store.
+func (c *GcStateCache) Forget(id desync.ChunkID) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(gcBucketChunks).Delete(id[:])
+	})
+}
+
+// ScrubCandidates returns a rotating ~1/buckets slice of cached chunk
+// IDs for this generation, so that drift between the cache and the
+// filesystem (a chunk removed outside of gcOnce, for instance) is
+// eventually corrected without re-verifying the whole inventory on
+// every run.
+func (c *GcStateCache) ScrubCandidates(generation, buckets uint64) ([]desync.ChunkID, error) {
+	if buckets == 0 {
+		buckets = 1
+	}
+
+	var ids []desync.ChunkID
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(gcBucketChunks).ForEach(func(k, v []byte) error {
+			if uint64(k[0])%buckets != generation%buckets {
+				return nil
+			}
+
+			var id desync.ChunkID
+			copy(id[:], k)
+			ids = append(ids, id)
+			return nil
+		})
+	})
+
+	return ids, err
+}
+
+// indexCacheEntry is a cached, already-parsed desync.Index keyed by the
+// index file's path and mtime.
+type indexCacheEntry struct {
+	mtime time.Time
+	index desync.Index
+}
+
+// IndexCache keeps parsed desync.Index chunk lists in memory across
+// GcInterval ticks, keyed by index path and mtime, so unchanged
+// .nar/.narinfo indices skip re-parsing and re-integrity-checking.
+type IndexCache struct {
+	mu      sync.Mutex
+	entries map[string]indexCacheEntry
+}
+
+func NewIndexCache() *IndexCache {
+	return &IndexCache{entries: map[string]indexCacheEntry{}}
+}
+
+// Get returns the cached index for path if it was cached at exactly
+// mtime; otherwise it returns false and the caller must re-parse.
+func (c *IndexCache) Get(path string, mtime time.Time) (desync.Index, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || !entry.mtime.Equal(mtime) {
+		return desync.Index{}, false
+	}
+	return entry.index, true
+}
+
+func (c *IndexCache) Put(path string, mtime time.Time, index desync.Index) {
+	c.mu.Lock()
+	c.entries[path] = indexCacheEntry{mtime: mtime, index: index}
+	c.mu.Unlock()
+}
+
+// Prune drops cache entries for indices that no longer exist, so the
+// map doesn't grow unbounded as indices are deleted over time.
+func (c *IndexCache) Prune(present map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for path := range c.entries {
+		if _, ok := present[path]; !ok {
+			delete(c.entries, path)
+		}
+	}
+}
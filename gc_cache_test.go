@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/folbricht/desync"
+)
+
+func openTestGcStateCache(t *testing.T) *GcStateCache {
+	t.Helper()
+	cache, err := OpenGcStateCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenGcStateCache: %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestGcStateCacheShardUnchangedRoundTrips(t *testing.T) {
+	cache := openTestGcStateCache(t)
+
+	mtime := time.Now().Truncate(time.Second)
+	stats := []*chunkStat{
+		{id: chunkIDFor(1), size: 100, mtime: mtime},
+		{id: chunkIDFor(2), size: 200, mtime: mtime},
+	}
+
+	if err := cache.UpdateShard("/store/aaaa", mtime, stats, 1); err != nil {
+		t.Fatalf("UpdateShard: %v", err)
+	}
+
+	got, ok := cache.ShardUnchanged("/store/aaaa", mtime, 2)
+	if !ok {
+		t.Fatal("expected ShardUnchanged to hit for an unchanged mtime")
+	}
+	if len(got) != len(stats) {
+		t.Fatalf("got %d cached stats, want %d", len(got), len(stats))
+	}
+	for i, stat := range got {
+		if stat.id != stats[i].id || stat.size != stats[i].size {
+			t.Fatalf("cached stat %d = %+v, want %+v", i, stat, stats[i])
+		}
+	}
+
+	if _, ok := cache.ShardUnchanged("/store/aaaa", mtime.Add(time.Second), 3); ok {
+		t.Fatal("expected ShardUnchanged to miss once the directory mtime changes")
+	}
+
+	if _, ok := cache.ShardUnchanged("/store/bbbb", mtime, 2); ok {
+		t.Fatal("expected ShardUnchanged to miss for a directory never scanned")
+	}
+}
+
+func TestGcStateCacheScrubCandidatesRotateByBucket(t *testing.T) {
+	cache := openTestGcStateCache(t)
+
+	mtime := time.Now()
+	stats := make([]*chunkStat, 0, 256)
+	for i := 0; i < 256; i++ {
+		stats = append(stats, &chunkStat{id: chunkIDFor(byte(i)), size: 1, mtime: mtime})
+	}
+	if err := cache.UpdateShard("/store/shard", mtime, stats, 1); err != nil {
+		t.Fatalf("UpdateShard: %v", err)
+	}
+
+	const buckets = 4
+	seen := map[desync.ChunkID]struct{}{}
+	for generation := uint64(0); generation < buckets; generation++ {
+		ids, err := cache.ScrubCandidates(generation, buckets)
+		if err != nil {
+			t.Fatalf("ScrubCandidates: %v", err)
+		}
+		for _, id := range ids {
+			if uint64(id[0])%buckets != generation%buckets {
+				t.Fatalf("chunk %v returned for generation %d doesn't belong to its bucket", id, generation)
+			}
+			seen[id] = struct{}{}
+		}
+	}
+
+	if len(seen) != len(stats) {
+		t.Fatalf("rotating through all %d buckets covered %d chunks, want all %d", buckets, len(seen), len(stats))
+	}
+}
+
+func TestGcStateCacheForgetRemovesChunk(t *testing.T) {
+	cache := openTestGcStateCache(t)
+
+	mtime := time.Now()
+	stats := []*chunkStat{{id: chunkIDFor(5), size: 1, mtime: mtime}}
+	if err := cache.UpdateShard("/store/cccc", mtime, stats, 1); err != nil {
+		t.Fatalf("UpdateShard: %v", err)
+	}
+
+	if err := cache.Forget(chunkIDFor(5)); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+
+	ids, err := cache.ScrubCandidates(0, 1)
+	if err != nil {
+		t.Fatalf("ScrubCandidates: %v", err)
+	}
+	for _, id := range ids {
+		if id == chunkIDFor(5) {
+			t.Fatal("forgotten chunk should no longer be a scrub candidate")
+		}
+	}
+}
+
+func TestIndexCachePrune(t *testing.T) {
+	c := NewIndexCache()
+	mtime := time.Now()
+
+	c.Put("/indices/a.narinfo", mtime, desync.Index{})
+	c.Put("/indices/b.narinfo", mtime, desync.Index{})
+
+	c.Prune(map[string]struct{}{"/indices/a.narinfo": {}})
+
+	if _, ok := c.Get("/indices/a.narinfo", mtime); !ok {
+		t.Fatal("Prune should keep entries that are still present")
+	}
+	if _, ok := c.Get("/indices/b.narinfo", mtime); ok {
+		t.Fatal("Prune should drop entries no longer present")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+
+	"github.com/folbricht/desync"
+)
+
+func chunkIDFor(b byte) desync.ChunkID {
+	var id desync.ChunkID
+	id[0] = b
+	return id
+}
+
+func TestChunkHeapOrdersByMtimeAscending(t *testing.T) {
+	base := time.Now()
+	h := &chunkHeap{}
+
+	heap.Init(h)
+	heap.Push(h, &chunkStat{id: chunkIDFor(3), mtime: base.Add(3 * time.Hour)})
+	heap.Push(h, &chunkStat{id: chunkIDFor(1), mtime: base.Add(1 * time.Hour)})
+	heap.Push(h, &chunkStat{id: chunkIDFor(2), mtime: base.Add(2 * time.Hour)})
+
+	var popped []byte
+	for h.Len() > 0 {
+		stat := heap.Pop(h).(*chunkStat)
+		popped = append(popped, stat.id[0])
+	}
+
+	want := []byte{1, 2, 3}
+	if len(popped) != len(want) {
+		t.Fatalf("popped %v, want %v", popped, want)
+	}
+	for i := range want {
+		if popped[i] != want[i] {
+			t.Fatalf("pop order %v, want oldest-first %v", popped, want)
+		}
+	}
+}
+
+func TestChunkLRUAddEvictsOldestPastSizeBudget(t *testing.T) {
+	base := time.Now()
+	lru := NewLRU(10)
+
+	lru.Add(&chunkStat{id: chunkIDFor(1), size: 6, mtime: base})
+	lru.Add(&chunkStat{id: chunkIDFor(2), size: 6, mtime: base.Add(time.Hour)})
+
+	if !lru.IsDead(chunkIDFor(1)) {
+		t.Fatal("expected the older, smaller-budget chunk to be evicted")
+	}
+	if lru.IsDead(chunkIDFor(2)) {
+		t.Fatal("the newer chunk should still be live")
+	}
+	if lru.IsCorrupt(chunkIDFor(1)) {
+		t.Fatal("a size-evicted chunk must not be reported as corrupt")
+	}
+}
+
+func TestChunkLRUAddDeadMarksCorrupt(t *testing.T) {
+	lru := NewLRU(100)
+	lru.AddDead(&chunkStat{id: chunkIDFor(9), size: 1})
+
+	if !lru.IsDead(chunkIDFor(9)) {
+		t.Fatal("AddDead should mark the chunk dead")
+	}
+	if !lru.IsCorrupt(chunkIDFor(9)) {
+		t.Fatal("AddDead should mark the chunk corrupt, unlike a size eviction")
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/folbricht/desync"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// condemnReason records why an index was pulled out of the live cache,
+// and which chunks were exclusively referenced by it (and therefore
+// quarantined alongside it rather than left as now-unreferenced dead
+// weight). It doubles as one entry of a quarantine batch's manifest.json.
+type condemnReason struct {
+	IndexPath       string   `json:"index_path"`
+	Reason          string   `json:"reason"`
+	ParseOffset     int64    `json:"parse_offset,omitempty"`
+	ExclusiveChunks []string `json:"exclusive_chunks,omitempty"`
+}
+
+// quarantineManifest is written as manifest.json next to the
+// quarantined files in <cache>/.trash/<timestamp>/.
+type quarantineManifest struct {
+	Batch       string          `json:"batch"`
+	CondemnedAt time.Time       `json:"condemned_at"`
+	Entries     []condemnReason `json:"entries"`
+}
+
+const quarantineTimeFormat = "20060102T150405Z"
+
+func quarantineRoot(cacheDir string) string {
+	return filepath.Join(cacheDir, ".trash")
+}
+
+// isValidQuarantineBatch reports whether batch is a well-formed batch
+// timestamp, as opposed to attacker-controlled input that could escape
+// quarantineRoot via filepath.Join (e.g. "../../etc"). Callers building
+// a path from a batch name supplied over HTTP must check this first.
+func isValidQuarantineBatch(batch string) bool {
+	_, err := time.Parse(quarantineTimeFormat, batch)
+	return err == nil
+}
+
+// cacheDirFromIndices derives the cache root (the parent of the index
+// tree) from an index store, since Proxy doesn't otherwise expose the
+// top-level cache directory to the GC subsystem.
+func cacheDirFromIndices(indices desync.LocalIndexStore) string {
+	return filepath.Dir(strings.TrimSuffix(indices.Path, string(filepath.Separator)))
+}
+
+// chunkFilePath reproduces desync's on-disk layout: a 4-hex-digit
+// prefix directory (see maxCacheDirPortion) containing the compressed
+// chunk file.
+func chunkFilePath(base string, id desync.ChunkID) string {
+	idStr := id.String()
+	return filepath.Join(base, idStr[:4], idStr+desync.CompressedChunkExt)
+}
+
+// isIntegrityExempt reports whether name (an index path relative to
+// indices.Path) matches one of proxy's configured exemption globs.
+// Indices matching an exemption are never quarantined even if their
+// integrity check fails; the failure is still logged so operators can
+// see it happening.
+func (proxy *Proxy) isIntegrityExempt(name string) bool {
+	for _, pattern := range proxy.IntegrityExemptPatterns {
+		if ok, err := filepath.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantineIndices moves each condemned index, and any chunk
+// exclusively referenced by it, into a fresh timestamped batch
+// directory under <cache>/.trash, alongside a JSON manifest describing
+// why each entry was condemned. Batches are left in place for the
+// configured grace period; PurgeQuarantine deletes them for good.
+func (proxy *Proxy) quarantineIndices(
+	cacheDir, indicesPath string,
+	locateChunk func(desync.ChunkID) (string, bool),
+	entries []condemnReason,
+	batchTime time.Time,
+) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	batch := batchTime.UTC().Format(quarantineTimeFormat)
+	batchDir := filepath.Join(quarantineRoot(cacheDir), batch)
+
+	if err := os.MkdirAll(filepath.Join(batchDir, "indices"), 0o755); err != nil {
+		return errors.WithMessage(err, "creating quarantine batch dir")
+	}
+	if err := os.MkdirAll(filepath.Join(batchDir, "chunks"), 0o755); err != nil {
+		return errors.WithMessage(err, "creating quarantine batch dir")
+	}
+
+	for _, entry := range entries {
+		rel := strings.TrimPrefix(entry.IndexPath, indicesPath)
+		dst := filepath.Join(batchDir, "indices", rel)
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			proxy.log.Error("creating quarantine dir for index", zap.Error(err), zap.String("path", entry.IndexPath))
+			continue
+		}
+		if err := os.Rename(entry.IndexPath, dst); err != nil {
+			proxy.log.Error("quarantining index", zap.Error(err), zap.String("path", entry.IndexPath))
+			continue
+		}
+
+		for _, idStr := range entry.ExclusiveChunks {
+			id, err := desync.ChunkIDFromString(idStr)
+			if err != nil {
+				continue
+			}
+
+			src, ok := locateChunk(id)
+			if !ok {
+				continue
+			}
+
+			dst := filepath.Join(batchDir, "chunks", id.String()+desync.CompressedChunkExt)
+			if err := os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+				proxy.log.Error("quarantining chunk", zap.Error(err), zap.String("chunk", idStr))
+			}
+		}
+	}
+
+	manifest := quarantineManifest{Batch: batch, CondemnedAt: batchTime, Entries: entries}
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(batchDir, "manifest.json"), buf, 0o644)
+}
+
+// PurgeQuarantine permanently deletes quarantine batches older than
+// grace, returning how many were removed.
+func (proxy *Proxy) PurgeQuarantine(cacheDir string, grace time.Duration) (int, error) {
+	root := quarantineRoot(cacheDir)
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-grace)
+	purged := 0
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		batchTime, err := time.Parse(quarantineTimeFormat, entry.Name())
+		if err != nil || batchTime.After(cutoff) {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			proxy.log.Error("purging quarantine batch", zap.Error(err), zap.String("batch", entry.Name()))
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// ListQuarantine returns the manifests of every quarantine batch still
+// on disk, most recently condemned first.
+func (proxy *Proxy) ListQuarantine(cacheDir string) ([]quarantineManifest, error) {
+	root := quarantineRoot(cacheDir)
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	manifests := make([]quarantineManifest, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		buf, err := os.ReadFile(filepath.Join(root, entry.Name(), "manifest.json"))
+		if err != nil {
+			continue
+		}
+
+		var manifest quarantineManifest
+		if err := json.Unmarshal(buf, &manifest); err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].CondemnedAt.After(manifests[j].CondemnedAt) })
+
+	return manifests, nil
+}
+
+// RestoreQuarantine moves every index and chunk from batch back into
+// the live index tree and store, e.g. after confirming a condemnation
+// was a false positive. Chunks are always restored to store, the
+// primary tier, regardless of which tier they were quarantined from.
+func (proxy *Proxy) RestoreQuarantine(cacheDir string, store desync.LocalStore, indices desync.LocalIndexStore, batch string) error {
+	if !isValidQuarantineBatch(batch) {
+		return errors.Errorf("invalid quarantine batch %q", batch)
+	}
+
+	batchDir := filepath.Join(quarantineRoot(cacheDir), batch)
+	indicesDir := filepath.Join(batchDir, "indices")
+	chunksDir := filepath.Join(batchDir, "chunks")
+
+	err := filepath.Walk(indicesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel := strings.TrimPrefix(path, indicesDir)
+		dst := filepath.Join(indices.Path, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		return os.Rename(path, dst)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithMessage(err, "restoring indices")
+	}
+
+	err = filepath.Walk(chunksDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name := info.Name()
+		ext := filepath.Ext(name)
+		id, err := desync.ChunkIDFromString(name[:len(name)-len(ext)])
+		if err != nil {
+			return nil
+		}
+		dst := chunkFilePath(store.Base, id)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		return os.Rename(path, dst)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithMessage(err, "restoring chunks")
+	}
+
+	return os.RemoveAll(batchDir)
+}
+
+// RegisterQuarantineRoutes wires ServeQuarantineHTTP onto mux at
+// "/quarantine". Call it next to the existing metrics/health
+// registrations when the admin server is set up.
+func (proxy *Proxy) RegisterQuarantineRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/quarantine", proxy.ServeQuarantineHTTP)
+}
+
+// ServeQuarantineHTTP handles GET (list), POST ?action=restore&batch=,
+// and POST ?action=purge[&grace=<duration>] against the quarantine
+// store. It is registered on the admin mux by RegisterQuarantineRoutes.
+func (proxy *Proxy) ServeQuarantineHTTP(w http.ResponseWriter, r *http.Request) {
+	store := proxy.primaryStore()
+	indices := proxy.localIndex.(desync.LocalIndexStore)
+	cacheDir := cacheDirFromIndices(indices)
+
+	switch {
+	case r.Method == http.MethodGet:
+		manifests, err := proxy.ListQuarantine(cacheDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(manifests)
+
+	case r.Method == http.MethodPost && r.URL.Query().Get("action") == "restore":
+		batch := r.URL.Query().Get("batch")
+		if batch == "" {
+			http.Error(w, "missing batch parameter", http.StatusBadRequest)
+			return
+		}
+		if err := proxy.RestoreQuarantine(cacheDir, store, indices, batch); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost && r.URL.Query().Get("action") == "purge":
+		grace := proxy.QuarantineGracePeriod
+		if raw := r.URL.Query().Get("grace"); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil {
+				http.Error(w, "invalid grace duration", http.StatusBadRequest)
+				return
+			}
+			grace = parsed
+		}
+
+		purged, err := proxy.PurgeQuarantine(cacheDir, grace)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(strconv.Itoa(purged) + " batches purged"))
+
+	default:
+		http.Error(w, "unsupported method/action", http.StatusMethodNotAllowed)
+	}
+}
+
+// primaryStore returns the tier-0/sole local store backing the cache,
+// whether or not proxy.localStore is a TieredStore.
+func (proxy *Proxy) primaryStore() desync.LocalStore {
+	if tiered, ok := proxy.localStore.(*TieredStore); ok {
+		return tiered.tiers[0].Store
+	}
+	return proxy.localStore.(desync.LocalStore)
+}
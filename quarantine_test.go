@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuarantineManifestRoundTrips(t *testing.T) {
+	want := quarantineManifest{
+		Batch:       "20260730T120000Z",
+		CondemnedAt: time.Date(2026, 7, 30, 12, 0, 0, 0, time.UTC),
+		Entries: []condemnReason{
+			{
+				IndexPath:       "/indices/a.narinfo",
+				Reason:          "index has no chunks",
+				ParseOffset:     -1,
+				ExclusiveChunks: []string{"deadbeef"},
+			},
+		},
+	}
+
+	buf, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got quarantineManifest
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if got.Batch != want.Batch || !got.CondemnedAt.Equal(want.CondemnedAt) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if len(got.Entries) != 1 || !reflect.DeepEqual(got.Entries[0], want.Entries[0]) {
+		t.Fatalf("got entries %+v, want %+v", got.Entries, want.Entries)
+	}
+}
+
+func TestIsValidQuarantineBatch(t *testing.T) {
+	cases := []struct {
+		batch string
+		valid bool
+	}{
+		{"20260730T120000Z", true},
+		{"../../../../etc", false},
+		{"", false},
+		{"20260730T120000Z/../../etc", false},
+	}
+
+	for _, c := range cases {
+		if got := isValidQuarantineBatch(c.batch); got != c.valid {
+			t.Errorf("isValidQuarantineBatch(%q) = %v, want %v", c.batch, got, c.valid)
+		}
+	}
+}
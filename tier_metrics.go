@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pascaldekloe/metrics"
+)
+
+// tierMetrics mirrors the flat spongix_chunk_*_local metrics, but scoped
+// to a single StoreTier via a tier label, so operators can query e.g.
+// spongix_chunk_size_local{tier="nvme"} on a tiered deployment.
+type tierMetrics struct {
+	maxSize    *metrics.Integer
+	chunkCount *metrics.Integer
+	chunkSize  *metrics.Integer
+	gcCount    *metrics.Counter
+	gcSize     *metrics.Counter
+}
+
+var (
+	tierMetricsMu    sync.Mutex
+	tierMetricsByTag = map[string]*tierMetrics{}
+)
+
+// metricsForTier returns the lazily-created metric set for tier name,
+// reusing it across GC runs so the underlying counters keep counting.
+func metricsForTier(name string) *tierMetrics {
+	tierMetricsMu.Lock()
+	defer tierMetricsMu.Unlock()
+
+	if m, ok := tierMetricsByTag[name]; ok {
+		return m
+	}
+
+	m := &tierMetrics{
+		maxSize:    metrics.MustInteger(fmt.Sprintf(`spongix_max_size_local{tier=%q}`, name), "Limit for this tier in bytes"),
+		chunkCount: metrics.MustInteger(fmt.Sprintf(`spongix_chunk_count_local{tier=%q}`, name), "Number of chunks in this tier"),
+		chunkSize:  metrics.MustInteger(fmt.Sprintf(`spongix_chunk_size_local{tier=%q}`, name), "Size of the chunks in this tier, in bytes"),
+		gcCount:    metrics.MustCounter(fmt.Sprintf(`spongix_chunk_gc_count_local{tier=%q}`, name), "Number of chunks demoted or deleted from this tier"),
+		gcSize:     metrics.MustCounter(fmt.Sprintf(`spongix_chunk_gc_bytes_local{tier=%q}`, name), "Size of chunks demoted or deleted from this tier"),
+	}
+	tierMetricsByTag[name] = m
+	return m
+}
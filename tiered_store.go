@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/folbricht/desync"
+	"github.com/pkg/errors"
+)
+
+// StoreTier is one backend in a TieredStore, e.g. a fast small SSD in
+// front of a large HDD. Tiers are ordered fastest-first; gcOnce applies
+// each tier's own size budget and demotes chunks it evicts to the next
+// tier instead of deleting them outright.
+type StoreTier struct {
+	// Name identifies the tier in metrics and logs, e.g. "nvme", "hdd".
+	Name string
+	// SizeGB is this tier's size budget in gigabytes.
+	SizeGB uint64
+
+	Store desync.LocalStore
+	Index desync.LocalIndexStore
+}
+
+// TieredStore implements desync.Store over an ordered list of StoreTier
+// backends. It has no index methods, so it does not implement
+// desync.IndexStore, and each StoreTier's Index is not consulted. Reads are satisfied by the first tier that
+// has the chunk, promoting it back to tier 0 so subsequently-hot chunks
+// converge on the fastest backend. Writes always land on tier 0; gcOnce
+// is responsible for demoting cold chunks down the tier list.
+type TieredStore struct {
+	tiers []*StoreTier
+}
+
+func NewTieredStore(tiers []*StoreTier) (*TieredStore, error) {
+	if len(tiers) == 0 {
+		return nil, errors.New("tiered store requires at least one tier")
+	}
+	return &TieredStore{tiers: tiers}, nil
+}
+
+func (t *TieredStore) String() string {
+	return "tiered store with " + t.tiers[0].Store.String()
+}
+
+// GetChunk returns chunk id from the first tier that has it, promoting
+// it to tier 0 if it was found further down.
+func (t *TieredStore) GetChunk(id desync.ChunkID) (*desync.Chunk, error) {
+	for i, tier := range t.tiers {
+		chunk, err := tier.Store.GetChunk(id)
+		if err != nil {
+			continue
+		}
+
+		if i > 0 {
+			t.promote(chunk)
+		}
+
+		return chunk, nil
+	}
+
+	return nil, errors.Errorf("chunk %s not found in any tier", id)
+}
+
+func (t *TieredStore) HasChunk(id desync.ChunkID) (bool, error) {
+	for _, tier := range t.tiers {
+		has, err := tier.Store.HasChunk(id)
+		if err != nil {
+			return false, err
+		}
+		if has {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// StoreChunk always writes to tier 0; cold chunks are pushed down to
+// slower tiers by gcOnce, not by callers.
+func (t *TieredStore) StoreChunk(chunk *desync.Chunk) error {
+	return t.tiers[0].Store.StoreChunk(chunk)
+}
+
+func (t *TieredStore) promote(chunk *desync.Chunk) {
+	if err := t.tiers[0].Store.StoreChunk(chunk); err != nil {
+		return
+	}
+}
+
+func (t *TieredStore) Close() error {
+	for _, tier := range t.tiers {
+		if err := tier.Store.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// demoteChunk moves id from one tier to the next: it is stored on dst
+// before being removed from src, so a crash in between leaves the chunk
+// readable (duplicated) rather than lost.
+func demoteChunk(src, dst *StoreTier, id desync.ChunkID) error {
+	chunk, err := src.Store.GetChunk(id)
+	if err != nil {
+		return errors.WithMessagef(err, "reading chunk %s from tier %s", id, src.Name)
+	}
+
+	if err := dst.Store.StoreChunk(chunk); err != nil {
+		return errors.WithMessagef(err, "storing chunk %s on tier %s", id, dst.Name)
+	}
+
+	if err := src.Store.RemoveChunk(id); err != nil {
+		return errors.WithMessagef(err, "removing chunk %s from tier %s", id, src.Name)
+	}
+
+	return nil
+}